@@ -0,0 +1,243 @@
+// Copyright 2016-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included in
+// the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+// file, in accordance with the Business Source License, use of this software
+// will be governed by the Apache License, Version 2.0, included in the file
+// licenses/APL2.txt.
+
+package mm
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// defaultArenaChunkSize is used when NewArena is called with a non-positive
+// chunkSize.
+const defaultArenaChunkSize = 1 << 20 // 1MB
+
+// arenaChunk is a single bulk jemalloc allocation that the Arena bump-
+// allocates within. Requests larger than the arena's chunkSize get their
+// own dedicated arenaChunk instead (see Arena.allocOversized).
+type arenaChunk struct {
+	base   unsafe.Pointer
+	size   int64
+	offset int64 // bump allocation cursor, updated atomically
+}
+
+// Arena is a bulk allocator layered on top of Malloc/Free, modeled on the
+// runtime arena concept: many small objects are bump-allocated out of a
+// handful of large jemalloc slabs and the whole region is released in one
+// shot with Free. This is a good fit for allocation bursts that all share
+// a lifetime, e.g. skiplist node bursts during bulk loads or the plasma
+// page builder, where paying per-object cgo crossings and jemalloc
+// bookkeeping dominates the cost.
+//
+// An Arena does not support freeing individual allocations; callers that
+// need that should use Malloc/Free directly.
+type Arena struct {
+	chunkSize int64
+
+	curChunk unsafe.Pointer // *arenaChunk, bump-allocated via the fast path
+
+	mu     sync.Mutex // guards chunks on the slow (new chunk) path
+	chunks []*arenaChunk
+
+	allocs int64
+	bytes  int64
+	freed  int32
+
+	stack []uintptr // NewArena call site, captured when Debug for leak reports
+}
+
+// NewArena creates an Arena that bulk-allocates jemalloc slabs of
+// chunkSize bytes and bump-allocates out of them. A non-positive
+// chunkSize falls back to a 1MB default.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunkSize
+	}
+
+	a := &Arena{chunkSize: int64(chunkSize)}
+	a.chunks = append(a.chunks, a.newChunk(a.chunkSize))
+	a.curChunk = unsafe.Pointer(a.chunks[0])
+
+	if Debug {
+		pcs := make([]uintptr, 32)
+		n := runtime.Callers(2, pcs)
+		a.stack = pcs[:n]
+
+		runtime.SetFinalizer(a, (*Arena).checkLeak)
+	}
+
+	return a
+}
+
+func (a *Arena) newChunk(size int64) *arenaChunk {
+	return &arenaChunk{base: Malloc(int(size)), size: size}
+}
+
+// checkLeak runs as a finalizer, so it must never panic - a panic there
+// crashes the program from a goroutine the caller has no way to recover or
+// even observe coming. Instead it records an ArenaLeak for CheckArenaLeaks
+// to report, the same way the asan build reports outstanding Mallocs.
+func (a *Arena) checkLeak() {
+	if atomic.LoadInt32(&a.freed) == 0 {
+		arenaLeaksMu.Lock()
+		arenaLeaks = append(arenaLeaks, ArenaLeak{
+			Bytes: atomic.LoadInt64(&a.bytes),
+			Stack: a.stack,
+		})
+		arenaLeaksMu.Unlock()
+	}
+}
+
+// ArenaLeak describes an Arena that was garbage collected without ever
+// having Free called on it.
+type ArenaLeak struct {
+	Bytes int64
+	Stack []uintptr
+}
+
+var (
+	arenaLeaksMu sync.Mutex
+	arenaLeaks   []ArenaLeak
+)
+
+// CheckArenaLeaks returns every Arena leak recorded so far and clears the
+// list. Meant to be polled periodically or from a test's t.Cleanup; leaks
+// are only recorded when Debug is set, since that's what gates attaching
+// the finalizer in NewArena.
+func CheckArenaLeaks() []ArenaLeak {
+	arenaLeaksMu.Lock()
+	defer arenaLeaksMu.Unlock()
+
+	leaks := arenaLeaks
+	arenaLeaks = nil
+	return leaks
+}
+
+// Alloc returns n bytes of uninitialized memory carved out of the arena.
+// The fast path is lock-free: it bump-allocates within the current chunk
+// using an atomic add. When the current chunk is exhausted, a new chunk
+// is installed under a lock; requests larger than chunkSize get their own
+// dedicated oversized allocation instead of forcing every chunk to be that
+// large.
+func (a *Arena) Alloc(n int) unsafe.Pointer {
+	if n <= 0 {
+		return nil
+	}
+
+	atomic.AddInt64(&a.allocs, 1)
+	atomic.AddInt64(&a.bytes, int64(n))
+	atomic.AddInt64(&arenaAllocsTotal, 1)
+	atomic.AddInt64(&arenaBytesTotal, int64(n))
+
+	if int64(n) > a.chunkSize {
+		return a.allocOversized(n)
+	}
+
+	for {
+		cp := atomic.LoadPointer(&a.curChunk)
+		c := (*arenaChunk)(cp)
+		off := atomic.AddInt64(&c.offset, int64(n))
+		if off <= c.size {
+			return unsafe.Pointer(uintptr(c.base) + uintptr(off-int64(n)))
+		}
+
+		// Current chunk is full. Only one racing allocator needs to install
+		// the replacement; the rest retry against whatever is current.
+		a.mu.Lock()
+		if atomic.LoadPointer(&a.curChunk) == cp {
+			nc := a.newChunk(a.chunkSize)
+			a.chunks = append(a.chunks, nc)
+			atomic.StorePointer(&a.curChunk, unsafe.Pointer(nc))
+		}
+		a.mu.Unlock()
+	}
+}
+
+func (a *Arena) allocOversized(n int) unsafe.Pointer {
+	c := a.newChunk(int64(n))
+	atomic.StoreInt64(&c.offset, int64(n))
+
+	a.mu.Lock()
+	a.chunks = append(a.chunks, c)
+	a.mu.Unlock()
+
+	return c.base
+}
+
+// Reset releases every chunk the arena holds back to jemalloc and starts
+// over with a single fresh chunk, so the Arena can be reused for another
+// burst without a matching NewArena/Free pair.
+func (a *Arena) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, c := range a.chunks {
+		Free(c.base)
+	}
+
+	nc := a.newChunk(a.chunkSize)
+	a.chunks = []*arenaChunk{nc}
+	atomic.StorePointer(&a.curChunk, unsafe.Pointer(nc))
+
+	atomic.StoreInt64(&a.allocs, 0)
+	atomic.StoreInt64(&a.bytes, 0)
+}
+
+// Free releases every chunk backing the arena back to jemalloc, one
+// mm_free per chunk. The Arena must not be used after calling Free.
+func (a *Arena) Free() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, c := range a.chunks {
+		Free(c.base)
+	}
+	a.chunks = nil
+	atomic.StorePointer(&a.curChunk, nil)
+
+	atomic.StoreInt32(&a.freed, 1)
+}
+
+// ArenaStats holds the allocation counters for a single Arena.
+type ArenaStats struct {
+	Allocs int64
+	Bytes  int64
+}
+
+// Stats returns the current allocs/bytes counters for this arena.
+func (a *Arena) Stats() ArenaStats {
+	return ArenaStats{
+		Allocs: atomic.LoadInt64(&a.allocs),
+		Bytes:  atomic.LoadInt64(&a.bytes),
+	}
+}
+
+// arenaAllocsTotal and arenaBytesTotal are cumulative counters across every
+// Arena.Alloc call ever made, the same shape as mm's own Mallocs/Frees
+// counters in malloc.go, so the package level Stats/StatsJson can report
+// arena usage alongside the jemalloc bin stats.
+//
+// This used to be a sync.Map keyed by *Arena, summed on demand by ranging
+// over the live set. That pinned every Arena it tracked: a sync.Map key is
+// a strong reference, so an Arena dropped without a matching Free() - the
+// exact leak checkLeak exists to catch - stayed reachable through the
+// registry forever, which suppresses its finalizer. Plain counters updated
+// at the allocation site carry the same information without holding a
+// reference to anything.
+var (
+	arenaAllocsTotal int64
+	arenaBytesTotal  int64
+)
+
+// aggregateArenaStats returns the cumulative allocs/bytes requested across
+// every Arena.Alloc call ever made.
+func aggregateArenaStats() (allocs, bytes int64) {
+	return atomic.LoadInt64(&arenaAllocsTotal), atomic.LoadInt64(&arenaBytesTotal)
+}
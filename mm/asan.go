@@ -0,0 +1,123 @@
+// Copyright 2016-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included in
+// the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+// file, in accordance with the Business Source License, use of this software
+// will be governed by the Apache License, Version 2.0, included in the file
+// licenses/APL2.txt.
+
+//go:build nitro_asan
+// +build nitro_asan
+
+package mm
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// asanPoisonByte overwrites freed regions so a subsequent use-after-free
+// reads obviously-garbage data instead of whatever jemalloc happens to still
+// have in that slab.
+const asanPoisonByte = 0xde
+
+// asanShards spreads the shadow map across multiple sync.Maps to cut lock
+// contention between allocator-heavy goroutines.
+const asanShards = 32
+
+type allocRecord struct {
+	size  int
+	stack []uintptr
+}
+
+var asanShadow [asanShards]sync.Map // each: map[uintptr]*allocRecord
+
+func shadowShard(p unsafe.Pointer) *sync.Map {
+	return &asanShadow[uintptr(p)%asanShards]
+}
+
+// asanTrackAlloc records a live allocation's size and call stack, keyed by
+// pointer, so Free can validate and poison it and CheckLeaks can report it.
+func asanTrackAlloc(p unsafe.Pointer, size int) {
+	if p == nil {
+		return
+	}
+
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	shadowShard(p).Store(uintptr(p), &allocRecord{size: size, stack: pcs[:n]})
+}
+
+// asanTrackFree validates p is a live, tracked allocation, poisons its bytes
+// before the real mm_free runs, and drops it from the shadow map. It panics
+// on a double free or a free of a pointer Malloc never returned, surfacing
+// the bug at the call site instead of letting jemalloc corrupt memory
+// silently.
+func asanTrackFree(p unsafe.Pointer) {
+	if p == nil {
+		return
+	}
+
+	shard := shadowShard(p)
+	v, ok := shard.Load(uintptr(p))
+	if !ok {
+		panic(fmt.Sprintf("mm: double free or free of untracked pointer %p", p))
+	}
+
+	rec := v.(*allocRecord)
+	poison(p, rec.size)
+	shard.Delete(uintptr(p))
+}
+
+// asanCheckLive panics if p is not a currently-tracked allocation, catching
+// use-after-free accesses that go through SizeAt.
+func asanCheckLive(p unsafe.Pointer) {
+	if p == nil {
+		return
+	}
+
+	if _, ok := shadowShard(p).Load(uintptr(p)); !ok {
+		panic(fmt.Sprintf("mm: use of freed or untracked pointer %p", p))
+	}
+}
+
+func poison(p unsafe.Pointer, size int) {
+	if size <= 0 {
+		return
+	}
+
+	b := unsafe.Slice((*byte)(p), size)
+	for i := range b {
+		b[i] = asanPoisonByte
+	}
+}
+
+// Leak describes a live allocation still outstanding when CheckLeaks runs.
+type Leak struct {
+	Ptr   unsafe.Pointer
+	Size  int
+	Stack []uintptr
+}
+
+// CheckLeaks snapshots the shadow map and returns every allocation that is
+// still outstanding, along with the stack it was allocated from. Meant to
+// be called from t.Cleanup in tests built with -tags nitro_asan.
+func CheckLeaks() []Leak {
+	var leaks []Leak
+
+	for i := range asanShadow {
+		asanShadow[i].Range(func(k, v interface{}) bool {
+			rec := v.(*allocRecord)
+			leaks = append(leaks, Leak{
+				Ptr:   unsafe.Pointer(k.(uintptr)),
+				Size:  rec.size,
+				Stack: rec.stack,
+			})
+			return true
+		})
+	}
+
+	return leaks
+}
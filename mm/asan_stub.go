@@ -0,0 +1,32 @@
+// Copyright 2016-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included in
+// the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+// file, in accordance with the Business Source License, use of this software
+// will be governed by the Apache License, Version 2.0, included in the file
+// licenses/APL2.txt.
+
+//go:build !nitro_asan
+// +build !nitro_asan
+
+package mm
+
+import "unsafe"
+
+// Leak describes a live allocation still outstanding when CheckLeaks runs.
+// It is only ever populated in builds tagged nitro_asan.
+type Leak struct {
+	Ptr   unsafe.Pointer
+	Size  int
+	Stack []uintptr
+}
+
+func asanTrackAlloc(p unsafe.Pointer, size int) {}
+
+func asanTrackFree(p unsafe.Pointer) {}
+
+func asanCheckLive(p unsafe.Pointer) {}
+
+// CheckLeaks is a no-op outside of builds tagged nitro_asan, so production
+// binaries pay nothing for the leak detector.
+func CheckLeaks() []Leak { return nil }
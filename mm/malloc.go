@@ -50,7 +50,9 @@ func Malloc(l int) unsafe.Pointer {
 	if Debug {
 		atomic.AddUint64(&stats.allocs, 1)
 	}
-	return C.mm_malloc(C.size_t(l))
+	p := C.mm_malloc(C.size_t(l))
+	asanTrackAlloc(p, l)
+	return p
 }
 
 // Free implements C like memory deallocator
@@ -58,11 +60,13 @@ func Free(p unsafe.Pointer) {
 	if Debug {
 		atomic.AddUint64(&stats.frees, 1)
 	}
+	asanTrackFree(p)
 	C.mm_free(p)
 }
 
 // SizeAt returns real allocated size from an allocated pointer
 func SizeAt(p unsafe.Pointer) int {
+	asanCheckLive(p)
 	return int(C.mm_sizeat(p))
 }
 
@@ -77,6 +81,10 @@ func Stats() string {
 	if Debug {
 		s += fmt.Sprintf("Mallocs = %d\n"+
 			"Frees   = %d\n", stats.allocs, stats.frees)
+
+		arenaAllocs, arenaBytes := aggregateArenaStats()
+		s += fmt.Sprintf("ArenaAllocs = %d\n"+
+			"ArenaBytes  = %d\n", arenaAllocs, arenaBytes)
 	}
 
 	if buf != nil {
@@ -125,6 +133,17 @@ func getBinsStats() map[string]JemallocBinStats {
 	return bs
 }
 
+// GetBinStats returns per-bin jemalloc fragmentation and resident-size
+// stats, the same data StatsJson embeds under the "bin_stats" key. Exported
+// so subpackages such as mm/promcollector can surface it without having to
+// round-trip through StatsJson's JSON encoding.
+func GetBinStats() map[string]JemallocBinStats {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return getBinsStats()
+}
+
 func StatsJson() string {
 	mu.Lock()
 	defer mu.Unlock()
@@ -145,6 +164,12 @@ func StatsJson() string {
 	}
 	stsJson["bin_stats"] = getBinsStats()
 
+	arenaAllocs, arenaBytes := aggregateArenaStats()
+	stsJson["arena_stats"] = map[string]uint64{
+		"allocs": uint64(arenaAllocs),
+		"bytes":  uint64(arenaBytes),
+	}
+
 	data, err := json.Marshal(stsJson)
 	if err != nil {
 		return s
@@ -0,0 +1,172 @@
+// Copyright 2016-Present Couchbase, Inc.
+//
+// Use of this software is governed by the Business Source License included in
+// the file licenses/BSL-Couchbase.txt.  As of the Change Date specified in that
+// file, in accordance with the Business Source License, use of this software
+// will be governed by the Apache License, Version 2.0, included in the file
+// licenses/APL2.txt.
+
+// Package promcollector exposes mm's jemalloc bin stats and allocator
+// counters as a prometheus.Collector. It lives outside the mm package so
+// that importing mm never pulls in a prometheus dependency.
+package promcollector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/couchbase/nitro/mm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultInterval is used by RegisterDefault and bounds how often the mm
+// stats are recomputed, since they are relatively expensive to gather.
+const defaultInterval = 10 * time.Second
+
+var (
+	binFragDesc = prometheus.NewDesc(
+		"nitro_jemalloc_bin_frag_percent",
+		"Fragmentation percentage of a jemalloc size-class bin.",
+		[]string{"size"}, nil)
+
+	binResidentDesc = prometheus.NewDesc(
+		"nitro_jemalloc_bin_resident_bytes",
+		"Resident bytes held by a jemalloc size-class bin.",
+		[]string{"size"}, nil)
+
+	sizeDesc = prometheus.NewDesc(
+		"nitro_jemalloc_size_bytes", "Total size allocated by the mm allocator.", nil, nil)
+
+	allocSizeDesc = prometheus.NewDesc(
+		"nitro_jemalloc_alloc_size_bytes", "Total size of active allocations.", nil, nil)
+
+	dirtySizeDesc = prometheus.NewDesc(
+		"nitro_jemalloc_dirty_size_bytes", "Unused dirty pages not yet purged.", nil, nil)
+
+	mallocsDesc = prometheus.NewDesc(
+		"nitro_jemalloc_mallocs_total", "Number of mm.Malloc calls.", nil, nil)
+
+	freesDesc = prometheus.NewDesc(
+		"nitro_jemalloc_frees_total", "Number of mm.Free calls.", nil, nil)
+)
+
+// snapshot is the cached result of the last mm stats refresh.
+type snapshot struct {
+	bins      map[string]mm.JemallocBinStats
+	size      uint64
+	allocSize uint64
+	dirtySize uint64
+	mallocs   uint64
+	frees     uint64
+}
+
+// Collector implements prometheus.Collector over mm's jemalloc bin stats.
+// The per-bin jemalloc stats are relatively expensive to gather, so a background goroutine
+// refreshes a cached snapshot on interval and scrapes are served from it
+// rather than recomputing on every Collect.
+type Collector struct {
+	interval time.Duration
+	stop     chan struct{}
+
+	mu   sync.Mutex
+	snap snapshot
+}
+
+// NewCollector creates a Collector that refreshes its cached snapshot of mm
+// stats every interval. A non-positive interval falls back to 10s. Call
+// Stop to shut down the background refresher.
+func NewCollector(interval time.Duration) *Collector {
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	c := &Collector{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+	c.refresh()
+	go c.loop()
+
+	return c
+}
+
+func (c *Collector) loop() {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			c.refresh()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Collector) refresh() {
+	mallocs, frees := mm.GetAllocStats()
+
+	snap := snapshot{
+		bins:      mm.GetBinStats(),
+		size:      mm.Size(),
+		allocSize: mm.AllocSize(),
+		dirtySize: mm.DirtySize(),
+		mallocs:   mallocs,
+		frees:     frees,
+	}
+
+	c.mu.Lock()
+	c.snap = snap
+	c.mu.Unlock()
+}
+
+// Stop halts the background refresher. The collector keeps serving its last
+// snapshot if Collect is called afterwards.
+func (c *Collector) Stop() {
+	close(c.stop)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- binFragDesc
+	ch <- binResidentDesc
+	ch <- sizeDesc
+	ch <- allocSizeDesc
+	ch <- dirtySizeDesc
+	ch <- mallocsDesc
+	ch <- freesDesc
+}
+
+// Collect implements prometheus.Collector, serving the cached snapshot
+// instead of recomputing the mm stats on every scrape.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	snap := c.snap
+	c.mu.Unlock()
+
+	for size, bs := range snap.bins {
+		ch <- prometheus.MustNewConstMetric(binFragDesc, prometheus.GaugeValue, float64(bs.FragPercent), size)
+		ch <- prometheus.MustNewConstMetric(binResidentDesc, prometheus.GaugeValue, float64(bs.Resident), size)
+	}
+
+	ch <- prometheus.MustNewConstMetric(sizeDesc, prometheus.GaugeValue, float64(snap.size))
+	ch <- prometheus.MustNewConstMetric(allocSizeDesc, prometheus.GaugeValue, float64(snap.allocSize))
+	ch <- prometheus.MustNewConstMetric(dirtySizeDesc, prometheus.GaugeValue, float64(snap.dirtySize))
+	ch <- prometheus.MustNewConstMetric(mallocsDesc, prometheus.CounterValue, float64(snap.mallocs))
+	ch <- prometheus.MustNewConstMetric(freesDesc, prometheus.CounterValue, float64(snap.frees))
+}
+
+// RegisterDefault creates a Collector with the default refresh interval and
+// registers it with registerer, returning the Collector so callers can Stop
+// it on shutdown.
+func RegisterDefault(registerer prometheus.Registerer) (*Collector, error) {
+	c := NewCollector(defaultInterval)
+	if err := registerer.Register(c); err != nil {
+		c.Stop()
+		return nil, fmt.Errorf("promcollector: failed to register collector: %w", err)
+	}
+
+	return c, nil
+}
@@ -11,6 +11,7 @@ package skiplist
 
 import (
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"unsafe"
@@ -58,6 +59,26 @@ import (
 * Because, even through accessors from a closed session has become zero, accessors from previous
 * closed session would be able to access items in the later closed session. Hence, a closed session
 * can be terminated only after termination of all previous closed sessions.
+*
+* Hazard pointers (ReclaimMode = HazardPointersReclaim):
+* The barrier session scheme above reclaims in units of a whole session, so a
+* single long-lived accessor pins every node deleted since it started, no
+* matter how few of them it actually touches. Hazard pointers reclaim a node
+* as soon as no live accessor has it published, independent of session
+* boundaries. Each accessor owns a small fixed-size hazardRec (handed out
+* from a sync.Pool, which approximates a per-thread slot table well enough
+* for goroutines). Before dereferencing a node, the accessor publishes it
+* into a slot with a release-store (BarrierSession.Publish) and must then
+* re-validate the pointer it read before the publish is still current -
+* otherwise it can retry, since the node it published may already be
+* unreachable. findPath does this for every node it walks past (see its own
+* doc comment). Delete appends the unlinked node to a shared retire list
+* (a mutex-protected slice, not a sync.Pool - retired nodes are the only
+* record of pending destructor calls, and a sync.Pool can drop them on GC
+* before they are ever reclaimed) instead of handing it to the destructor
+* immediately; once that list crosses retireListCap, the reclaimer sorts
+* every currently-published hazard pointer and frees any retired node
+* absent from that set.
 * */
 
 // BarrierSessionDestructor is a callback for SMR based reclaim of objects
@@ -65,12 +86,70 @@ type BarrierSessionDestructor func(objectRef unsafe.Pointer)
 
 const barrierFlushOffset = math.MaxInt32 / 2
 
+// ReclaimMode selects the SMR algorithm an AccessBarrier uses to decide when
+// a deleted node can be safely handed to its destructor.
+type ReclaimMode int
+
+const (
+	// BarrierSessionReclaim is the default: a deleted node waits for every
+	// accessor live at delete time to leave the skiplist before reclaim.
+	BarrierSessionReclaim ReclaimMode = iota
+	// HazardPointersReclaim reclaims a deleted node as soon as it is no
+	// longer published in any accessor's hazard slots, bounding the memory
+	// a single long-lived reader can pin.
+	HazardPointersReclaim
+)
+
+const (
+	// numHazardPtrs is the number of hazard slots an accessor gets: one for
+	// the node it is visiting and one for its predecessor.
+	numHazardPtrs = 2
+	// hazardSlotCurr is the slot findPath publishes the node it is about to
+	// dereference into.
+	hazardSlotCurr = 0
+	// hazardSlotPrev is the slot findPath publishes that node's predecessor
+	// into, so the predecessor stays protected for the getNext call made on
+	// it after curr is replaced by its successor.
+	hazardSlotPrev = 1
+	// retireListCap is how many unlinked nodes accumulate on the shared
+	// retire list before the reclaimer scans published hazard pointers.
+	retireListCap = 64
+)
+
+// hazardRec is the per-accessor published-pointer table used by
+// HazardPointersReclaim. Accessors obtain one from AccessBarrier.hazardPool,
+// a sync.Pool (not keyed by goroutine) that approximates a thread-local slot
+// table, and return it to the pool on Release.
+type hazardRec struct {
+	slots [numHazardPtrs]unsafe.Pointer
+}
+
 // BarrierSession handle tracks the live accessors of a barrier session
 type BarrierSession struct {
 	liveCount *int32
 	objectRef unsafe.Pointer
 	seqno     uint64
 	closed    int32
+
+	hazard *hazardRec // only set when AccessBarrier.mode == HazardPointersReclaim
+}
+
+// Publish stores ptr into hazard slot idx with a release-store, making it
+// visible to the reclaimer before the node is dereferenced. It is a no-op
+// outside HazardPointersReclaim.
+func (bs *BarrierSession) Publish(idx int, ptr unsafe.Pointer) {
+	if bs == nil || bs.hazard == nil {
+		return
+	}
+	atomic.StorePointer(&bs.hazard.slots[idx], ptr)
+}
+
+// Clear removes whatever was published in hazard slot idx.
+func (bs *BarrierSession) Clear(idx int) {
+	if bs == nil || bs.hazard == nil {
+		return
+	}
+	atomic.StorePointer(&bs.hazard.slots[idx], nil)
 }
 
 // CompareBS is a barrier session comparator based on seqno
@@ -94,11 +173,22 @@ type AccessBarrier struct {
 	activeSeqno uint64
 	session     unsafe.Pointer
 	callb       BarrierSessionDestructor
+	mode        ReclaimMode
 
 	freeq               *Skiplist
 	freeSeqno           uint64
 	isDestructorRunning int32
 
+	hazardPool sync.Pool // *hazardRec
+	hazardRecs sync.Map  // set of every hazardRec ever handed out: map[*hazardRec]struct{}
+
+	// retireMu guards retireNodes, the shared accumulation list for
+	// HazardPointersReclaim. This can't be a sync.Pool: pooled values are
+	// dropped on GC, which would silently lose retired nodes - and the
+	// destructors they were waiting on - before they ever reach a scan.
+	retireMu    sync.Mutex
+	retireNodes []unsafe.Pointer
+
 	numAllocated int64
 	numFreed     int64
 
@@ -107,22 +197,55 @@ type AccessBarrier struct {
 }
 
 func newAccessBarrier(active bool, callb BarrierSessionDestructor) *AccessBarrier {
+	return newAccessBarrierWithMode(active, callb, BarrierSessionReclaim)
+}
+
+// newAccessBarrierWithMode creates an AccessBarrier whose reclamation
+// backend is chosen by mode. HazardPointersReclaim trades the simplicity of
+// BarrierSessionReclaim for bounded pinning: it reclaims a node as soon as
+// no accessor has it published, instead of waiting out a whole session.
+func newAccessBarrierWithMode(active bool, callb BarrierSessionDestructor, mode ReclaimMode) *AccessBarrier {
 	ab := &AccessBarrier{
 		active:       active,
 		session:      unsafe.Pointer(newBarrierSession()),
 		callb:        callb,
+		mode:         mode,
 		numAllocated: 1,
 	}
+
 	if active {
-		ab.freeq = New()
+		switch mode {
+		case HazardPointersReclaim:
+			ab.hazardPool.New = func() interface{} {
+				rec := &hazardRec{}
+				ab.hazardRecs.Store(rec, struct{}{})
+				return rec
+			}
+		default:
+			ab.freeq = New()
+		}
 	}
+
 	return ab
 }
 
+// Mode returns the reclamation backend this barrier was constructed with.
+func (ab *AccessBarrier) Mode() ReclaimMode {
+	return ab.mode
+}
+
 func (ab *AccessBarrier) GetStats() (int64, int64, int64, uint64) {
 	if ab.freeq != nil {
 		return ab.numAllocated, ab.numFreed, int64(ab.freeq.GetStats().NodeCount), ab.freeSeqno
 	}
+
+	if ab.mode == HazardPointersReclaim {
+		ab.retireMu.Lock()
+		pending := int64(len(ab.retireNodes))
+		ab.retireMu.Unlock()
+		return ab.numAllocated, atomic.LoadInt64(&ab.numFreed), pending, ab.freeSeqno
+	}
+
 	return ab.numAllocated, ab.numFreed, 0, ab.freeSeqno
 }
 
@@ -151,44 +274,138 @@ func (ab *AccessBarrier) doCleanup() {
 
 // Acquire marks enter of an accessor in the skiplist
 func (ab *AccessBarrier) Acquire() *BarrierSession {
-	if ab.active {
-	retry:
-		bs := (*BarrierSession)(atomic.LoadPointer(&ab.session))
-		liveCount := atomic.AddInt32(bs.liveCount, 1)
-		if liveCount > barrierFlushOffset {
-			ab.Release(bs)
-			goto retry
-		}
+	if !ab.active {
+		return nil
+	}
+
+	if ab.mode == HazardPointersReclaim {
+		return &BarrierSession{hazard: ab.hazardPool.Get().(*hazardRec)}
+	}
 
-		return bs
+retry:
+	bs := (*BarrierSession)(atomic.LoadPointer(&ab.session))
+	liveCount := atomic.AddInt32(bs.liveCount, 1)
+	if liveCount > barrierFlushOffset {
+		ab.Release(bs)
+		goto retry
 	}
 
-	return nil
+	return bs
 }
 
 // Release marks leaving of an accessor in the skiplist
 func (ab *AccessBarrier) Release(bs *BarrierSession) {
-	if ab.active {
-		liveCount := atomic.AddInt32(bs.liveCount, -1)
-		if liveCount == barrierFlushOffset {
-			buf := ab.freeq.MakeBuf()
-			defer ab.freeq.FreeBuf(buf)
-
-			// Accessors which entered a closed barrier session steps down automatically
-			// But, they may try to close an already closed session.
-			if atomic.AddInt32(&bs.closed, 1) == 1 {
-				ab.freeq.Insert(unsafe.Pointer(bs), CompareBS, buf, &ab.freeq.Stats)
-				if atomic.CompareAndSwapInt32(&ab.isDestructorRunning, 0, 1) {
-					ab.doCleanup()
-					atomic.CompareAndSwapInt32(&ab.isDestructorRunning, 1, 0)
-				}
+	if !ab.active {
+		return
+	}
+
+	if ab.mode == HazardPointersReclaim {
+		for i := range bs.hazard.slots {
+			atomic.StorePointer(&bs.hazard.slots[i], nil)
+		}
+		ab.hazardPool.Put(bs.hazard)
+		return
+	}
+
+	liveCount := atomic.AddInt32(bs.liveCount, -1)
+	if liveCount == barrierFlushOffset {
+		buf := ab.freeq.MakeBuf()
+		defer ab.freeq.FreeBuf(buf)
+
+		// Accessors which entered a closed barrier session steps down automatically
+		// But, they may try to close an already closed session.
+		if atomic.AddInt32(&bs.closed, 1) == 1 {
+			ab.freeq.Insert(unsafe.Pointer(bs), CompareBS, buf, &ab.freeq.Stats)
+			if atomic.CompareAndSwapInt32(&ab.isDestructorRunning, 0, 1) {
+				ab.doCleanup()
+				atomic.CompareAndSwapInt32(&ab.isDestructorRunning, 1, 0)
 			}
-		} else if liveCount < 0 || liveCount == barrierFlushOffset-1 {
-			panic("Unsafe memory reclamation detected")
 		}
+	} else if liveCount < 0 || liveCount == barrierFlushOffset-1 {
+		panic("Unsafe memory reclamation detected")
 	}
 }
 
+// Retire is the HazardPointersReclaim counterpart of FlushSession: it places
+// an unlinked node on the shared retire list instead of handing it to the
+// destructor immediately. Once that list grows past retireListCap, the
+// accumulated batch is handed to reclaimUnpublished, which sorts every
+// currently-published hazard pointer into a set and frees any retired node
+// absent from it.
+func (ab *AccessBarrier) Retire(objectRef unsafe.Pointer) {
+	ab.retireMu.Lock()
+	ab.retireNodes = append(ab.retireNodes, objectRef)
+
+	var batch []unsafe.Pointer
+	if len(ab.retireNodes) >= retireListCap {
+		batch = ab.retireNodes
+		ab.retireNodes = nil
+	}
+	ab.retireMu.Unlock()
+
+	if batch != nil {
+		ab.reclaimUnpublished(batch)
+	}
+}
+
+// reclaimUnpublished frees every node in batch that is not currently
+// published in any accessor's hazard slots, and puts whatever is still
+// published back on the shared retire list for the next round. Concurrent
+// callers each own a disjoint batch taken under retireMu, so this only
+// needs to coordinate with them when merging survivors back in.
+func (ab *AccessBarrier) reclaimUnpublished(batch []unsafe.Pointer) {
+	published := ab.sortedHazardPtrs()
+
+	remaining := batch[:0]
+	var freed int64
+	for _, node := range batch {
+		if hazardSetContains(published, node) {
+			remaining = append(remaining, node)
+			continue
+		}
+
+		ab.callb(node)
+		freed++
+	}
+
+	if freed > 0 {
+		atomic.AddInt64(&ab.numFreed, freed)
+	}
+
+	if len(remaining) > 0 {
+		ab.retireMu.Lock()
+		ab.retireNodes = append(remaining, ab.retireNodes...)
+		ab.retireMu.Unlock()
+	}
+}
+
+func (ab *AccessBarrier) sortedHazardPtrs() []unsafe.Pointer {
+	var published []unsafe.Pointer
+
+	ab.hazardRecs.Range(func(k, _ interface{}) bool {
+		rec := k.(*hazardRec)
+		for i := range rec.slots {
+			if p := atomic.LoadPointer(&rec.slots[i]); p != nil {
+				published = append(published, p)
+			}
+		}
+		return true
+	})
+
+	sort.Slice(published, func(i, j int) bool {
+		return uintptr(published[i]) < uintptr(published[j])
+	})
+
+	return published
+}
+
+func hazardSetContains(sorted []unsafe.Pointer, p unsafe.Pointer) bool {
+	i := sort.Search(len(sorted), func(i int) bool {
+		return uintptr(sorted[i]) >= uintptr(p)
+	})
+	return i < len(sorted) && sorted[i] == p
+}
+
 // FlushSession closes the current barrier session and starts the new session.
 // The caller should provide the destructor pointer for the new session.
 func (ab *AccessBarrier) FlushSession(ref unsafe.Pointer) {
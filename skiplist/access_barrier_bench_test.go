@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package skiplist
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+// benchItem is a minimal Item used to drive the skiplist in these
+// benchmarks; the truncated tree has no Item implementation of its own to
+// reuse.
+type benchItem int
+
+func (b benchItem) Compare(other Item) int {
+	return int(b) - int(other.(benchItem))
+}
+
+// benchmarkMixedReadDelete fills a skiplist, then runs concurrent readers
+// (findPath via Iterator.Seek) alongside a steady trickle of deletes, using
+// an AccessBarrier in the given mode to reclaim deleted nodes. It reports
+// the reclaimer's backlog depth (freeq length or pending retire count)
+// alongside the standard benchmark metrics, since that backlog is exactly
+// what HazardPointersReclaim is meant to bound tighter than
+// BarrierSessionReclaim, and under HazardPointersReclaim it fails outright
+// if deletes happened but nothing ever reached the reclaimer.
+func benchmarkMixedReadDelete(b *testing.B, mode ReclaimMode) {
+	const n = 1 << 16
+
+	s := New()
+	ab := newAccessBarrierWithMode(true, func(objectRef unsafe.Pointer) {}, mode)
+	s.Barrier = ab
+
+	for i := 0; i < n; i++ {
+		s.Insert(benchItem(i))
+	}
+
+	var deletes int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		buf := s.MakeBuf()
+		defer s.FreeBuf(buf)
+
+		for pb.Next() {
+			itm := benchItem(rng.Intn(n))
+
+			if rng.Intn(64) == 0 {
+				s.Delete(itm)
+				atomic.AddInt64(&deletes, 1)
+				continue
+			}
+
+			it := s.NewIterator(compareBenchItem, buf)
+			it.Seek(itm)
+			it.Close()
+		}
+	})
+
+	_, numFreed, backlog, _ := ab.GetStats()
+	b.ReportMetric(float64(backlog), "reclaim-backlog")
+	b.ReportMetric(float64(atomic.LoadInt64(&deletes)), "deletes")
+
+	// Under HazardPointersReclaim, Delete hands every unlinked node straight
+	// to Retire, so a node it unlinked ends up counted exactly once, either
+	// still sitting in the backlog or already freed. BarrierSessionReclaim
+	// reclaims only when an external caller invokes FlushSession, which this
+	// benchmark never does, so backlog/numFreed staying at 0 there is
+	// expected and not checked.
+	if mode == HazardPointersReclaim {
+		if d := atomic.LoadInt64(&deletes); d > 0 && backlog+numFreed == 0 {
+			b.Fatalf("%d deletes occurred but reclaim backlog and freed count are both 0", d)
+		}
+	}
+}
+
+// compareBenchItem adapts benchItem.Compare to the CompareFn shape Iterator
+// expects.
+func compareBenchItem(this, that Item) int {
+	return this.Compare(that)
+}
+
+func BenchmarkMixedReadDelete_BarrierSession(b *testing.B) {
+	benchmarkMixedReadDelete(b, BarrierSessionReclaim)
+}
+
+func BenchmarkMixedReadDelete_HazardPointers(b *testing.B) {
+	benchmarkMixedReadDelete(b, HazardPointersReclaim)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file
+// except in compliance with the License. You may obtain a copy of the License at
+//   http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing, software distributed under the
+// License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND,
+// either express or implied. See the License for the specific language governing permissions
+// and limitations under the License.
+
+package skiplist
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// CompareFn compares two items the same way Item.Compare does. Iterator
+// takes it explicitly instead of only relying on Item.Compare so callers
+// can plug in whatever comparator their index already has in hand.
+type CompareFn func(this, that Item) int
+
+// ActionBuffer is scratch space reserved for skiplist operations that need
+// to walk predecessor/successor paths. Iterator only carries it: findPath
+// does not use it and still allocates its own preds/succs on every call.
+type ActionBuffer struct {
+	preds, succs [MaxLevel + 1]*Node
+}
+
+// MakeBuf allocates a new ActionBuffer for use with this skiplist.
+func (s *Skiplist) MakeBuf() *ActionBuffer {
+	return &ActionBuffer{}
+}
+
+// FreeBuf releases an ActionBuffer obtained from MakeBuf.
+func (s *Skiplist) FreeBuf(buf *ActionBuffer) {}
+
+// Iterator walks a Skiplist's level-0 linked list in item order.
+type Iterator struct {
+	s   *Skiplist
+	cmp CompareFn
+	buf *ActionBuffer
+
+	curr *Node
+	hi   Item // upper bound set by SeekRange, nil for unbounded
+
+	bs     *BarrierSession // session every positioning method publishes into
+	ownsBS bool            // true when Close should release bs itself
+	snap   *Snapshot       // non-nil when built from Snapshot.NewIterator
+}
+
+// NewIterator returns an Iterator over s in item order. The iterator
+// acquires its own barrier session up front and holds it for its whole
+// lifetime, so every positioning method below can publish the node it's
+// about to dereference - the same invariant findPath relies on. Call Close
+// when done with the iterator to release it.
+func (s *Skiplist) NewIterator(cmp CompareFn, buf *ActionBuffer) *Iterator {
+	bs := s.acquireBarrier()
+	return &Iterator{s: s, cmp: cmp, buf: buf, bs: bs, ownsBS: true}
+}
+
+// Close releases any resources held by the iterator, including the barrier
+// session acquired by NewIterator. An iterator built from Snapshot.NewIterator
+// instead shares the Snapshot's session, which Snapshot.Release owns, so
+// Close is a no-op for it.
+func (it *Iterator) Close() {
+	if it.ownsBS {
+		it.s.releaseBarrier(it.bs)
+	}
+}
+
+// SeekFirst positions the iterator at the first live item.
+func (it *Iterator) SeekFirst() {
+	it.hi = nil
+	it.curr, _ = advanceHazard(it.s.head, it.bs)
+	it.skipInvisible()
+}
+
+// Seek positions the iterator at the first live item >= itm.
+func (it *Iterator) Seek(itm Item) {
+	_, succs, _ := it.s.findPath(itm, it.bs)
+	it.curr = succs[0]
+	it.skipInvisible()
+}
+
+// advanceHazard reads node's level-0 link and publishes the result into bs's
+// hazardSlotCurr before returning it, so the caller can safely dereference
+// it next - node itself must already be protected, either by a previous
+// publish or by being s.head, which is never reclaimed. node is first moved
+// into hazardSlotPrev so it stays protected while hazardSlotCurr is
+// overwritten. A reload of node's link after the publish confirms it is
+// still current, retrying otherwise; this is the same pattern findPath uses
+// and for the same reason.
+func advanceHazard(node *Node, bs *BarrierSession) (*Node, bool) {
+	bs.Publish(hazardSlotPrev, unsafe.Pointer(node))
+	for {
+		next, deleted := node.getNext(0)
+		bs.Publish(hazardSlotCurr, unsafe.Pointer(next))
+		if reval, _ := node.getNext(0); reval == next {
+			return next, deleted
+		}
+	}
+}
+
+// SeekRange positions the iterator at the first item >= lo and records hi
+// as the upper bound: Valid reports false once the current item compares
+// greater than hi, so a range scan doesn't need a separate bounds check on
+// every iteration.
+func (it *Iterator) SeekRange(lo, hi Item) {
+	it.hi = hi
+	it.Seek(lo)
+}
+
+// Valid reports whether the iterator is positioned at a live item within
+// whatever upper bound SeekRange set.
+func (it *Iterator) Valid() bool {
+	if it.curr == nil || it.curr == it.s.tail {
+		return false
+	}
+	if it.hi != nil && it.cmp(it.curr.itm, it.hi) > 0 {
+		return false
+	}
+	return true
+}
+
+// Next advances the iterator to the next live item.
+func (it *Iterator) Next() {
+	it.curr, _ = advanceHazard(it.curr, it.bs)
+	it.skipInvisible()
+}
+
+// GetNode returns the node the iterator is currently positioned at.
+func (it *Iterator) GetNode() *Node {
+	return it.curr
+}
+
+// Item returns the item the iterator is currently positioned at.
+func (it *Iterator) Item() Item {
+	return it.curr.itm
+}
+
+// Count consumes the iterator from its current position and returns the
+// number of live items it passes over. It exists so a range count can be
+// had in one pass instead of a scan that re-traverses from head just to
+// tally up a length.
+func (it *Iterator) Count() int {
+	n := 0
+	for ; it.Valid(); it.Next() {
+		n++
+	}
+	return n
+}
+
+// skipInvisible advances past any node that should not be shown: one
+// that's delete-marked at level 0, unless the iterator was built from a
+// Snapshot and the node was deleted strictly after the snapshot was taken,
+// in which case it still existed at snapshot time and stays visible.
+func (it *Iterator) skipInvisible() {
+	for it.curr != nil && it.curr != it.s.tail {
+		_, deleted := it.curr.getNext(0)
+		if !deleted || (it.snap != nil && it.snap.deletedAfterSnapshot(it.curr)) {
+			return
+		}
+		it.curr, _ = advanceHazard(it.curr, it.bs)
+	}
+}
+
+// Snapshot is a consistent, point-in-time view of the skiplist built on top
+// of the existing AccessBarrier: an Iterator created from it hides any node
+// that was already deleted as of the seqno the snapshot pinned, while still
+// showing nodes deleted afterwards, since those existed when the snapshot
+// was taken. A node deleted afterwards is only shown while it is still
+// linked at level 0: Delete unlinks it through findPath right after marking
+// it, and from then on the iterator no longer reaches it, so the view is not
+// a full point-in-time copy.
+type Snapshot struct {
+	seqno uint64
+	bs    *BarrierSession
+	s     *Skiplist
+}
+
+// Snapshot acquires a barrier session and records the current delete seqno
+// as the point a consistent range scan should observe. Under
+// BarrierSessionReclaim the session pins every node visible right now, so
+// none of them can be reclaimed while the Snapshot is alive. Under
+// HazardPointersReclaim the session only protects the nodes published in
+// its hazard slots, so other deleted nodes can be reclaimed while the
+// Snapshot is alive. Call Release once done with it.
+//
+// This deliberately does not call AccessBarrier.FlushSession: that closes
+// the barrier's *current* session and starts a new one, which would corrupt
+// bookkeeping for any other accessor already mid-way through accumulating
+// against that session (e.g. a caller outside this package holding the
+// Barrier directly). Acquire is enough on its own to pin the view Snapshot
+// needs.
+func (s *Skiplist) Snapshot() *Snapshot {
+	snap := &Snapshot{
+		seqno: atomic.LoadUint64(&s.deleteSeqno),
+		s:     s,
+	}
+
+	if s.Barrier != nil {
+		snap.bs = s.Barrier.Acquire()
+	}
+
+	return snap
+}
+
+// Release lets go of the barrier session pinned by this Snapshot, allowing
+// reclamation of any node it had kept visible to proceed.
+func (snap *Snapshot) Release() {
+	if snap.bs != nil {
+		snap.s.Barrier.Release(snap.bs)
+	}
+}
+
+// NewIterator returns an Iterator over the skiplist the snapshot was taken
+// from, restricted to the consistent point-in-time view the snapshot
+// pinned. The iterator shares the Snapshot's barrier session instead of
+// acquiring its own, since Snapshot.Release - not Iterator.Close - owns
+// that session's lifetime.
+func (snap *Snapshot) NewIterator(cmp CompareFn, buf *ActionBuffer) *Iterator {
+	return &Iterator{s: snap.s, cmp: cmp, buf: buf, bs: snap.bs, snap: snap}
+}
+
+// deletedAfterSnapshot reports whether node was delete-marked strictly
+// after this snapshot was taken, meaning it still existed as of snapshot
+// time and should stay visible to the snapshot's iterator.
+func (snap *Snapshot) deletedAfterSnapshot(node *Node) bool {
+	seqno := atomic.LoadUint64(&node.deletedAtSeqno)
+	return seqno > snap.seqno
+}
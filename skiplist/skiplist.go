@@ -17,6 +17,18 @@ type Skiplist struct {
 	head  *Node
 	tail  *Node
 	level int32
+
+	// deleteSeqno is a monotonic counter stamped onto a node's
+	// deletedAtSeqno by Delete, giving Snapshot a point in time to
+	// compare against for a consistent range scan.
+	deleteSeqno uint64
+
+	// Barrier, when set, is acquired and released by Insert, Delete and
+	// iterators around each access, and held by Snapshot for as long as the
+	// Snapshot is held (under BarrierSessionReclaim that pins reclamation of
+	// nodes visible at snapshot time). Skiplist does not create one itself;
+	// the owner wires it up.
+	Barrier *AccessBarrier
 }
 
 func New() *Skiplist {
@@ -47,6 +59,15 @@ type Node struct {
 	next  []unsafe.Pointer
 	itm   Item
 	level uint16
+
+	// deletedAtSeqno is the Skiplist.deleteSeqno value Delete stamped this
+	// node with right before it attempted the delete-mark CAS, or 0 if the
+	// node has never been deleted. Delete always performs the store before
+	// the CAS, in program order, and Go's sequentially consistent atomics
+	// compose across the two, so any reader that observes the delete-mark
+	// also observes a non-zero deletedAtSeqno - there is no window where a
+	// marked-deleted node can be read back with a zero seqno.
+	deletedAtSeqno uint64
 }
 type NodeRef struct {
 	deleted bool
@@ -111,7 +132,38 @@ func (s *Skiplist) helpDelete(level int, prev, curr, next *Node) bool {
 	return prev.dcasNext(level, curr, next, false, false)
 }
 
-func (s *Skiplist) findPath(itm Item) (preds, succs []*Node, found bool) {
+// acquireBarrier acquires a session on s.Barrier, or returns nil if the
+// skiplist has no barrier attached. The nil case makes every hazard-pointer
+// call in findPath a no-op, so callers don't need to special-case it.
+func (s *Skiplist) acquireBarrier() *BarrierSession {
+	if s.Barrier == nil {
+		return nil
+	}
+	return s.Barrier.Acquire()
+}
+
+// releaseBarrier is the counterpart to acquireBarrier; safe to call with a
+// nil bs.
+func (s *Skiplist) releaseBarrier(bs *BarrierSession) {
+	if s.Barrier == nil {
+		return
+	}
+	s.Barrier.Release(bs)
+}
+
+// findPath walks down from head to find the predecessors/successors of itm
+// at every level, helping along any delete-marked nodes it passes through.
+//
+// bs is the caller's barrier session. Under HazardPointersReclaim it is
+// non-nil, and before findPath dereferences prev or curr it publishes the
+// pointer into bs's hazard slots with a release-store, then re-loads prev's
+// link to confirm it still names curr: if a concurrent Delete unlinked and
+// retired curr in the window before the publish became visible, the reload
+// observes a different node and findPath retries instead of touching memory
+// that may already have been handed back to the destructor. Under
+// BarrierSessionReclaim, or when the skiplist has no Barrier at all, bs is
+// nil and BarrierSession.Publish is a no-op.
+func (s *Skiplist) findPath(itm Item, bs *BarrierSession) (preds, succs []*Node, found bool) {
 	var cmpVal int = 1
 
 	preds = make([]*Node, MaxLevel+1)
@@ -119,11 +171,18 @@ func (s *Skiplist) findPath(itm Item) (preds, succs []*Node, found bool) {
 
 retry:
 	prev := s.head
+	bs.Publish(hazardSlotPrev, unsafe.Pointer(prev))
+
 	level := int(atomic.LoadInt32(&s.level))
 	for i := level; i >= 0; i-- {
 		curr, _ := prev.getNext(i)
 	levelSearch:
 		for {
+			bs.Publish(hazardSlotCurr, unsafe.Pointer(curr))
+			if reval, _ := prev.getNext(i); reval != curr {
+				goto retry
+			}
+
 			next, deleted := curr.getNext(i)
 			for deleted {
 				if !s.helpDelete(i, prev, curr, next) {
@@ -131,12 +190,17 @@ retry:
 				}
 
 				curr, _ = prev.getNext(i)
+				bs.Publish(hazardSlotCurr, unsafe.Pointer(curr))
+				if reval, _ := prev.getNext(i); reval != curr {
+					goto retry
+				}
 				next, deleted = curr.getNext(i)
 			}
 
 			cmpVal = curr.itm.Compare(itm)
 			if cmpVal < 0 {
 				prev = curr
+				bs.Publish(hazardSlotPrev, unsafe.Pointer(prev))
 				curr, _ = prev.getNext(i)
 			} else {
 				break levelSearch
@@ -160,8 +224,12 @@ func (s *Skiplist) Insert(itm Item) {
 func (s *Skiplist) Insert2(itm Item, randFn func() float32) {
 	itemLevel := s.randomLevel(randFn)
 	x := newNode(itm, itemLevel)
+
+	bs := s.acquireBarrier()
+	defer s.releaseBarrier(bs)
+
 retry:
-	preds, succs, _ := s.findPath(itm)
+	preds, succs, _ := s.findPath(itm, bs)
 
 	x.setNext(0, succs[0], false)
 	if !preds[0].dcasNext(0, succs[0], x, false, false) {
@@ -175,19 +243,28 @@ retry:
 			if preds[i].dcasNext(i, succs[i], x, false, false) {
 				break fixThisLevel
 			}
-			preds, succs, _ = s.findPath(itm)
+			preds, succs, _ = s.findPath(itm, bs)
 		}
 	}
 }
 
 func (s *Skiplist) Delete(itm Item) {
 	var deleteMarked bool
-	_, succs, found := s.findPath(itm)
+
+	bs := s.acquireBarrier()
+	defer s.releaseBarrier(bs)
+
+	_, succs, found := s.findPath(itm, bs)
 	if !found {
 		return
 	}
 
 	delNode := succs[0]
+
+	// Stamp the logical delete seqno before attempting any delete-mark CAS
+	// below - see the invariant documented on Node.deletedAtSeqno.
+	atomic.StoreUint64(&delNode.deletedAtSeqno, atomic.AddUint64(&s.deleteSeqno, 1))
+
 	targetLevel := int(delNode.level)
 	for i := targetLevel; i >= 0; i-- {
 		next, deleted := delNode.getNext(i)
@@ -198,7 +275,22 @@ func (s *Skiplist) Delete(itm Item) {
 	}
 
 	if deleteMarked {
-		s.findPath(itm)
+		s.findPath(itm, bs)
+		s.retireIfHazard(delNode)
+	}
+
+}
+
+// retireIfHazard hands a node Delete just fully unlinked to the barrier's
+// HazardPointersReclaim retire list, once it is safe to free as soon as no
+// accessor still has it published. BarrierSessionReclaim reclaims through
+// its own session/freeq bookkeeping instead (see FlushSession), and a nil or
+// inactive Barrier has no reclaim scheme running at all, so both are no-ops
+// here.
+func (s *Skiplist) retireIfHazard(node *Node) {
+	if s.Barrier == nil || !s.Barrier.active || s.Barrier.Mode() != HazardPointersReclaim {
+		return
 	}
 
+	s.Barrier.Retire(unsafe.Pointer(node))
 }
\ No newline at end of file